@@ -0,0 +1,273 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command cli-login performs an OIDC Authorization Code + PKCE login from
+// the command line and emits the resulting tokens as a Kubernetes
+// client-go ExecCredential object, so it can be wired up as a kubectl
+// exec credential plugin:
+//
+//	users:
+//	- name: my-user
+//	  user:
+//	    exec:
+//	      apiVersion: client.authentication.k8s.io/v1beta1
+//	      command: cli-login
+//	      args: ["--issuer", "https://example.okta.com", "--client-id", "..."]
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/internal/oauthcli"
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/provider"
+)
+
+// oidcMetadata is the subset of `.well-known/openid-configuration` this
+// tool depends on.
+type oidcMetadata struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+func main() {
+	issuer := flag.String("issuer", os.Getenv("OKTA_IDX_ISSUER"), "the Okta org or authorization server issuer, e.g. https://example.okta.com/oauth2/default")
+	clientID := flag.String("client-id", os.Getenv("OKTA_IDX_CLIENTID"), "the OAuth 2.0 client ID")
+	scopes := flag.String("scopes", "openid profile offline_access", "space separated list of scopes to request")
+	skipBrowser := flag.Bool("skip-browser", false, "print the authorization URL instead of opening the default browser")
+	flag.Parse()
+
+	if *issuer == "" || *clientID == "" {
+		fmt.Fprintln(os.Stderr, "cli-login: --issuer and --client-id are required")
+		os.Exit(1)
+	}
+
+	cred, err := login(*issuer, *clientID, strings.Fields(*scopes), *skipBrowser)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cli-login: %s\n", err)
+		os.Exit(1)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cred); err != nil {
+		fmt.Fprintf(os.Stderr, "cli-login: failed to write ExecCredential: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// login drives the full loopback Authorization Code + PKCE flow: discover
+// the issuer's endpoints, stand up a callback listener, open (or print)
+// the authorization URL, wait for the redirect, and exchange the code.
+func login(issuer, clientID string, scopes []string, skipBrowser bool) (*oauthcli.ExecCredential, error) {
+	metadata, err := discover(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover issuer metadata: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start loopback listener: %w", err)
+	}
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+
+	pkce, err := oauthcli.CreatePKCEData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pkce data: %w", err)
+	}
+	state, err := randomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create state: %w", err)
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create nonce: %w", err)
+	}
+
+	authURL := buildAuthURL(metadata.AuthorizationEndpoint, clientID, redirectURI, scopes, state, nonce, pkce)
+
+	if skipBrowser {
+		fmt.Fprintf(os.Stderr, "Go to the following link in your browser:\n\n  %s\n\n", authURL)
+	} else {
+		if err := openBrowser(authURL); err != nil {
+			fmt.Fprintf(os.Stderr, "could not open browser automatically, go to the following link:\n\n  %s\n\n", authURL)
+		}
+	}
+
+	code, err := awaitCallback(listener, state)
+	if err != nil {
+		return nil, fmt.Errorf("callback failed: %w", err)
+	}
+
+	tokens, err := exchangeCode(metadata.TokenEndpoint, clientID, redirectURI, code, pkce.CodeVerifier)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned error: %s: %s", tokens.Error, tokens.ErrorDescription)
+	}
+
+	if err := oauthcli.VerifyIDToken(issuer, clientID, tokens.IdToken, map[string]string{"nonce": nonce}); err != nil {
+		return nil, fmt.Errorf("id_token verification failed: %w", err)
+	}
+
+	return oauthcli.NewExecCredential(tokens), nil
+}
+
+// discover fetches and parses the issuer's OpenID Connect discovery
+// document.
+func discover(issuer string) (*oidcMetadata, error) {
+	resp, err := http.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata oidcMetadata
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return nil, err
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" {
+		return nil, fmt.Errorf("discovery document is missing authorization_endpoint or token_endpoint")
+	}
+	return &metadata, nil
+}
+
+func buildAuthURL(authorizationEndpoint, clientID, redirectURI string, scopes []string, state, nonce string, pkce *oauthcli.PKCE) string {
+	q := url.Values{}
+	q.Set("client_id", clientID)
+	q.Set("response_type", "code")
+	q.Set("response_mode", "query")
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("redirect_uri", redirectURI)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", pkce.CodeChallenge)
+	q.Set("code_challenge_method", pkce.CodeChallengeMethod)
+
+	return authorizationEndpoint + "?" + q.Encode()
+}
+
+// awaitCallback blocks until the loopback listener receives the redirect
+// from the authorization endpoint, validates state, and returns the
+// authorization code.
+func awaitCallback(listener net.Listener, state string) (string, error) {
+	codeCh := make(chan string, 1)
+	errCh := make(chan error, 1)
+
+	srv := &http.Server{}
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The browser tab that's sitting on this loopback origin will
+		// commonly also fire something like a GET /favicon.ico against
+		// it alongside the real redirect. Ignore anything that isn't
+		// the callback itself instead of treating its missing query
+		// params as a fatal error.
+		if r.URL.Path != "/callback" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		q := r.URL.Query()
+		if errParam := q.Get("error"); errParam != "" {
+			errCh <- fmt.Errorf("authorization server returned error: %s: %s", errParam, q.Get("error_description"))
+			fmt.Fprintln(w, "Login failed, you may close this window.")
+			return
+		}
+		if q.Get("state") != state {
+			errCh <- fmt.Errorf("state mismatch in callback")
+			fmt.Fprintln(w, "Login failed, you may close this window.")
+			return
+		}
+		code := q.Get("code")
+		if code == "" {
+			errCh <- fmt.Errorf("callback did not include a code")
+			fmt.Fprintln(w, "Login failed, you may close this window.")
+			return
+		}
+		codeCh <- code
+		fmt.Fprintln(w, "Login successful, you may close this window.")
+	})
+
+	go srv.Serve(listener)
+	defer srv.Shutdown(context.Background())
+
+	select {
+	case code := <-codeCh:
+		return code, nil
+	case err := <-errCh:
+		return "", err
+	case <-time.After(5 * time.Minute):
+		return "", fmt.Errorf("timed out waiting for the browser to redirect back")
+	}
+}
+
+func exchangeCode(tokenEndpoint, clientID, redirectURI, code, codeVerifier string) (provider.Tokens, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("client_id", clientID)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("code", code)
+	data.Set("code_verifier", codeVerifier)
+
+	var tokens provider.Tokens
+	if err := oauthcli.PostForm(tokenEndpoint, data, &tokens); err != nil {
+		return provider.Tokens{}, err
+	}
+	return tokens, nil
+}
+
+// openBrowser opens url using the OS-appropriate command.
+func openBrowser(url string) error {
+	var cmd string
+	var args []string
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd, args = "open", []string{url}
+	case "windows":
+		cmd, args = "rundll32", []string{"url.dll,FileProtocolHandler", url}
+	default:
+		cmd, args = "xdg-open", []string{url}
+	}
+	return exec.Command(cmd, args...).Start()
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,133 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command device-login performs an OAuth 2.0 Device Authorization Grant
+// (RFC 8628) login for devices that can't open a browser themselves -
+// TVs, kiosks, headless CLIs. It prints a user_code and
+// verification_uri, along with a QR code encoding
+// verification_uri_complete so a phone can scan it, then polls Okta's
+// token endpoint until the user approves the request on a second device.
+// The resulting tokens are written to the same on-disk tokencache the
+// browser-based sample uses, so the web app's refreshMiddleware can reuse
+// the refresh_token; device-login itself does not read the cache, so
+// every run starts a new device authorization. It also emits a
+// Kubernetes client-go ExecCredential
+// object on success, so it can be wired up as a kubectl exec credential
+// plugin the same way cli-login is:
+//
+//	users:
+//	- name: my-user
+//	  user:
+//	    exec:
+//	      apiVersion: client.authentication.k8s.io/v1beta1
+//	      command: device-login
+//	      args: ["--issuer", "https://example.okta.com", "--client-id", "..."]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/internal/oauthcli"
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/provider"
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/tokencache"
+)
+
+func main() {
+	issuer := flag.String("issuer", os.Getenv("OKTA_IDX_ISSUER"), "the Okta org or authorization server issuer, e.g. https://example.okta.com/oauth2/default")
+	clientID := flag.String("client-id", os.Getenv("OKTA_IDX_CLIENTID"), "the OAuth 2.0 client ID")
+	scopes := flag.String("scopes", "openid profile offline_access", "space separated list of scopes to request")
+	flag.Parse()
+
+	if *issuer == "" || *clientID == "" {
+		fmt.Fprintln(os.Stderr, "device-login: --issuer and --client-id are required")
+		os.Exit(1)
+	}
+
+	cred, err := login(*issuer, *clientID, strings.Fields(*scopes))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "device-login: %s\n", err)
+		os.Exit(1)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cred); err != nil {
+		fmt.Fprintf(os.Stderr, "device-login: failed to write ExecCredential: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// login drives the full device authorization flow: request a
+// device_code/user_code pair, display it for the user to approve on
+// another device, poll until they do, then verify and cache the result.
+func login(issuer, clientID string, scopes []string) (*oauthcli.ExecCredential, error) {
+	da, err := oauthcli.BeginDeviceAuth(issuer, clientID, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin device authorization: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "To sign in, use a browser to open %s and enter the code: %s\n\n", da.VerificationURI, da.UserCode)
+	if qr, err := qrcode.New(da.VerificationURIComplete, qrcode.Medium); err == nil {
+		fmt.Fprintln(os.Stderr, qr.ToString(false))
+	} else {
+		fmt.Fprintf(os.Stderr, "(could not render QR code: %s)\n", err)
+	}
+	fmt.Fprintln(os.Stderr, "Waiting for approval...")
+
+	tokens, err := oauthcli.PollDeviceToken(issuer, clientID, da)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := oauthcli.VerifyIDToken(issuer, clientID, tokens.IdToken, nil); err != nil {
+		return nil, fmt.Errorf("id_token verification failed: %w", err)
+	}
+
+	if err := cacheTokens(issuer, clientID, scopes, tokens); err != nil {
+		fmt.Fprintf(os.Stderr, "device-login: could not cache tokens: %s\n", err)
+	}
+
+	return oauthcli.NewExecCredential(tokens), nil
+}
+
+// cacheTokens persists a successful device authorization to the same
+// on-disk tokencache the browser-based sample uses, so refreshMiddleware
+// can pick up the refresh_token instead of forcing another interactive
+// login.
+func cacheTokens(issuer, clientID string, scopes []string, tokens provider.Tokens) error {
+	cache, err := tokencache.New()
+	if err != nil {
+		return fmt.Errorf("could not open token cache: %w", err)
+	}
+	entry := tokencache.Entry{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		Scopes:       scopes,
+		TokenType:    tokens.TokenType,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IdToken:      tokens.IdToken,
+		Expiry:       time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second),
+	}
+	return cache.Put(entry)
+}
@@ -0,0 +1,93 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/internal/oauthcli"
+)
+
+// DeviceHandler begins the OAuth 2.0 Device Authorization Grant (RFC
+// 8628): it asks Okta for a user_code and verification_uri_complete,
+// renders them - along with a QR code encoding
+// verification_uri_complete - so the user can approve the request on a
+// second device, then polls the token endpoint in the background. A
+// successful poll is cached the same way LoginCallbackHandler caches a
+// browser login, into the one on-disk tokencache that refreshMiddleware
+// reads.
+func DeviceHandler(w http.ResponseWriter, r *http.Request) {
+	scopes := scopesWithOfflineAccess(cfg.Okta.IDX.Scopes)
+
+	da, err := oauthcli.BeginDeviceAuth(cfg.Okta.IDX.Issuer, cfg.Okta.IDX.ClientID, scopes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not begin device authorization: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	qr, err := qrcode.Encode(da.VerificationURIComplete, qrcode.Medium, 256)
+	if err != nil {
+		fmt.Printf("could not render device authorization QR code: %s\n", err.Error())
+	}
+
+	type customData struct {
+		IsAuthenticated         bool
+		UserCode                string
+		VerificationURI         string
+		VerificationURIComplete string
+		QRCodeDataURI           string
+	}
+
+	data := customData{
+		IsAuthenticated:         isAuthenticated(r),
+		UserCode:                da.UserCode,
+		VerificationURI:         da.VerificationURI,
+		VerificationURIComplete: da.VerificationURIComplete,
+		QRCodeDataURI:           "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr),
+	}
+	if err := tpl.ExecuteTemplate(w, "device.gohtml", data); err != nil {
+		fmt.Printf("error: %s\n", err.Error())
+	}
+
+	go pollAndCacheDeviceToken(da, scopes)
+}
+
+// pollAndCacheDeviceToken polls the token endpoint until the user
+// approves or denies the request on their other device, or it expires,
+// then verifies and caches the resulting tokens. It runs detached from
+// the request that rendered the device page, since the approval happens
+// out of band.
+func pollAndCacheDeviceToken(da *oauthcli.DeviceAuthorization, scopes []string) {
+	exchange, err := oauthcli.PollDeviceToken(cfg.Okta.IDX.Issuer, cfg.Okta.IDX.ClientID, da)
+	if err != nil {
+		fmt.Printf("device authorization did not complete: %s\n", err.Error())
+		return
+	}
+
+	if _, err := idp.VerifyIDToken(exchange.IdToken, ""); err != nil {
+		fmt.Printf("device flow id_token failed verification: %s\n", err.Error())
+		return
+	}
+
+	if err := cacheTokens(exchange); err != nil {
+		fmt.Printf("could not cache device flow tokens: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,233 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package oauthcli holds the OAuth 2.0 client-side plumbing shared by
+// this sample's non-browser entrypoints - cmd/cli-login's loopback
+// Authorization Code + PKCE flow, cmd/device-login's Device
+// Authorization Grant flow, and the web app's own "/device" handler -
+// so these entrypoints share one copy of the form POST, ID token
+// verification, PKCE, device grant, and ExecCredential output logic.
+// The web app's browser flow keeps its own PKCE helper in main.go and
+// verifies ID tokens through the provider package.
+package oauthcli
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	verifier "github.com/okta/okta-jwt-verifier-golang"
+
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/provider"
+)
+
+// defaultDevicePollInterval is the polling interval to use when a device
+// authorization response doesn't specify one, per RFC 8628 section 3.2.
+const defaultDevicePollInterval = 5 * time.Second
+
+// execCredentialAPIVersion is the apiVersion kubectl expects on the
+// ExecCredential object written to stdout.
+const execCredentialAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// ExecCredential is the shape kubectl expects back on stdout from an
+// exec credential plugin. Only the fields the exec plugin protocol
+// defines are included.
+type ExecCredential struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Status     ExecCredentialStatus `json:"status"`
+}
+
+// ExecCredentialStatus is the `status` field of an ExecCredential.
+type ExecCredentialStatus struct {
+	ExpirationTimestamp string `json:"expirationTimestamp,omitempty"`
+	Token               string `json:"token"`
+}
+
+// NewExecCredential builds the ExecCredential kubectl expects on stdout
+// from a successful token exchange.
+func NewExecCredential(tokens provider.Tokens) *ExecCredential {
+	status := ExecCredentialStatus{Token: tokens.AccessToken}
+	if tokens.ExpiresIn > 0 {
+		status.ExpirationTimestamp = time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second).Format(time.RFC3339)
+	}
+	return &ExecCredential{
+		APIVersion: execCredentialAPIVersion,
+		Kind:       "ExecCredential",
+		Status:     status,
+	}
+}
+
+// PKCE holds the code verifier/challenge pair used across an
+// authorization request and its subsequent token exchange.
+type PKCE struct {
+	CodeVerifier        string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// CreatePKCEData creates the PKCE data for an authorization code flow.
+func CreatePKCEData() (*PKCE, error) {
+	codeVerifier, err := createCodeVerifier()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create codeVerifier: %w", err)
+	}
+
+	h := sha256.New()
+	if _, err := h.Write([]byte(codeVerifier)); err != nil {
+		return nil, fmt.Errorf("failed to write codeVerifier: %w", err)
+	}
+	codeChallenge := base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+
+	return &PKCE{
+		CodeVerifier:        codeVerifier,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: "S256",
+	}, nil
+}
+
+func createCodeVerifier() (string, error) {
+	codeVerifier := make([]byte, 86)
+	if _, err := rand.Read(codeVerifier); err != nil {
+		return "", fmt.Errorf("error creating code_verifier: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(codeVerifier), nil
+}
+
+// PostForm issues a POST with a url.Values-encoded body and decodes the
+// JSON response into out.
+func PostForm(endpoint string, data url.Values, out interface{}) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader([]byte(data.Encode())))
+	if err != nil {
+		return fmt.Errorf("failed to build request to %s: %w", endpoint, err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Accept", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response from %s: %w", endpoint, err)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response from %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// VerifyIDToken validates idToken was issued by issuer for clientID,
+// along with any additional claims (e.g. "nonce") the caller wants
+// checked.
+func VerifyIDToken(issuer, clientID, idToken string, extraClaims map[string]string) error {
+	if idToken == "" {
+		return fmt.Errorf("token response did not include an id_token")
+	}
+	claims := map[string]string{"aud": clientID}
+	for k, v := range extraClaims {
+		claims[k] = v
+	}
+	jv := verifier.JwtVerifier{
+		Issuer:           issuer,
+		ClaimsToValidate: claims,
+	}
+	_, err := jv.New().VerifyIdToken(idToken)
+	return err
+}
+
+// DeviceAuthorization is the response from a device authorization
+// endpoint, RFC 8628 section 3.2.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// BeginDeviceAuth asks issuer's device authorization endpoint for a
+// device_code/user_code pair for clientID and scopes.
+func BeginDeviceAuth(issuer, clientID string, scopes []string) (*DeviceAuthorization, error) {
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("scope", strings.Join(scopes, " "))
+
+	var da DeviceAuthorization
+	if err := PostForm(issuer+"/oauth2/v1/device/authorize", data, &da); err != nil {
+		return nil, err
+	}
+	if da.DeviceCode == "" || da.UserCode == "" {
+		return nil, fmt.Errorf("device authorization response is missing device_code or user_code")
+	}
+	if da.Interval <= 0 {
+		da.Interval = int(defaultDevicePollInterval / time.Second)
+	}
+	return &da, nil
+}
+
+// PollDeviceToken polls issuer's token endpoint for da.DeviceCode with
+// the device_code grant, honoring the interval, slow_down,
+// authorization_pending, and expired_token semantics of RFC 8628
+// sections 3.4 and 3.5.
+func PollDeviceToken(issuer, clientID string, da *DeviceAuthorization) (provider.Tokens, error) {
+	interval := time.Duration(da.Interval) * time.Second
+	deadline := time.Now().Add(time.Duration(da.ExpiresIn) * time.Second)
+
+	data := url.Values{}
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+	data.Set("device_code", da.DeviceCode)
+	data.Set("client_id", clientID)
+
+	for {
+		time.Sleep(interval)
+		if time.Now().After(deadline) {
+			return provider.Tokens{}, fmt.Errorf("device code expired before the user approved the request")
+		}
+
+		var tokens provider.Tokens
+		if err := PostForm(issuer+"/oauth2/v1/token", data, &tokens); err != nil {
+			return provider.Tokens{}, err
+		}
+
+		switch tokens.Error {
+		case "":
+			return tokens, nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += defaultDevicePollInterval
+			continue
+		case "expired_token":
+			return provider.Tokens{}, fmt.Errorf("device code expired before the user approved the request")
+		default:
+			return provider.Tokens{}, fmt.Errorf("token endpoint returned error: %s: %s", tokens.Error, tokens.ErrorDescription)
+		}
+	}
+}
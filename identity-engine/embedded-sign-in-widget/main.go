@@ -17,15 +17,12 @@
 package main
 
 import (
-	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
@@ -38,18 +35,18 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/howeyc/fsnotify"
-	verifier "github.com/okta/okta-jwt-verifier-golang"
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/provider"
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/tokencache"
 	"github.com/spf13/viper"
 )
 
 var tpl *template.Template
 var sessionStoreName = "okta-self-hosted-session-store"
-var sessionKey = "randomKey"
-var sessionStore = sessions.NewCookieStore([]byte(sessionKey))
-var state = "ApplicationState"
-var nonce = "NonceNotSetYet"
+var sessionStore *sessions.CookieStore
 var cfg = &config{}
-var pkce *PKCE
+var secrets *sessionSecrets
+var tokenCache *tokencache.Cache
+var idp provider.Provider
 
 type PKCE struct {
 	CodeVerifier        string
@@ -66,6 +63,32 @@ func init() {
 		fmt.Printf("failed to read config: %s\n", err.Error())
 		os.Exit(1)
 	}
+
+	tokenCache, err = tokencache.New()
+	if err != nil {
+		fmt.Printf("failed to open token cache: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	idp, err = newProvider(cfg)
+	if err != nil {
+		fmt.Printf("failed to configure identity provider: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	secrets, err = loadSessionSecrets(cfg)
+	if err != nil {
+		fmt.Printf("failed to load session secrets: %s\n", err.Error())
+		os.Exit(1)
+	}
+	sessionStore = sessions.NewCookieStore(secrets.HashKey, secrets.BlockKey)
+	sessionStore.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   7 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
 }
 
 func main() {
@@ -75,8 +98,10 @@ func main() {
 	r.HandleFunc("/", HomeHandler).Methods("GET")
 	r.HandleFunc("/login", LoginHandler).Methods("GET")
 	r.HandleFunc("/login/callback", LoginCallbackHandler).Methods("GET")
-	r.HandleFunc("/profile", ProfileHandler).Methods("GET")
+	r.Handle("/profile", refreshMiddleware(http.HandlerFunc(ProfileHandler))).Methods("GET")
 	r.HandleFunc("/logout", LogoutHandler).Methods("POST")
+	r.HandleFunc("/logout/callback", LogoutCallbackHandler).Methods("GET")
+	r.HandleFunc("/device", DeviceHandler).Methods("GET")
 
 	addr := "127.0.0.1:8080"
 	logger := log.New(os.Stderr, "http: ", log.LstdFlags)
@@ -198,26 +223,48 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
-	if session.Values["pkceData"] == nil || session.Values["pkceData"] == "" {
+
+	var pkce *PKCE
+	if cv, ok := session.Values["pkce_code_verifier"].(string); ok && cv != "" {
+		pkce = &PKCE{
+			CodeVerifier:        cv,
+			CodeChallenge:       session.Values["pkce_code_challenge"].(string),
+			CodeChallengeMethod: session.Values["pkce_code_challenge_method"].(string),
+		}
+	} else {
 		pkce, err = createPKCEData()
 		if err != nil {
-			fmt.Printf("could not create pkce data: %s\n", err.Error())
-			os.Exit(1)
+			http.Error(w, fmt.Sprintf("could not create pkce data: %s", err.Error()), http.StatusInternalServerError)
+			return
 		}
 		session.Values["pkce_code_verifier"] = pkce.CodeVerifier
 		session.Values["pkce_code_challenge"] = pkce.CodeChallenge
 		session.Values["pkce_code_challenge_method"] = pkce.CodeChallengeMethod
-		session.Save(r, w)
-	} else {
-		pkce.CodeVerifier = session.Values["pkce_code_verifier"].(string)
-		pkce.CodeChallenge = session.Values["pkce_code_challenge"].(string)
-		pkce.CodeChallengeMethod = session.Values["pkce_code_challenge_method"].(string)
 	}
-	nonce, err := generateNonce()
+
+	signedState, nonce, err := newLoginState(session, secrets.StateKey)
 	if err != nil {
-		fmt.Printf("error: %s\n", err.Error())
-		os.Exit(1)
+		http.Error(w, fmt.Sprintf("could not create login state: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+
+	authReq, err := idp.AuthCodeURL(signedState, nonce, pkce.CodeChallenge, pkce.CodeChallengeMethod)
+	if err != nil {
+		fmt.Printf("could not begin authorization request: %s\n", err.Error())
+	}
+
+	// Providers that drive a hosted login page (standard OIDC, discovery)
+	// redirect the browser there directly. Okta IDX instead returns an
+	// interaction_handle and renders the embedded sign-in widget below.
+	if authReq.RedirectURL != "" {
+		http.Redirect(w, r, authReq.RedirectURL, http.StatusFound)
+		return
+	}
+
 	type customData struct {
 		IsAuthenticated   bool
 		BaseUrl           string
@@ -229,10 +276,6 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		Pkce              *PKCE
 	}
 
-	interactionHandle, err := getInteractionHandle(pkce.CodeChallenge)
-	if err != nil {
-		fmt.Printf("could not get interactionHandle: %s\n", err.Error())
-	}
 	issuerURL := fmt.Sprintf("%s/", cfg.Okta.IDX.Issuer)
 	issuerParts, err := url.Parse(issuerURL)
 	if err != nil {
@@ -246,10 +289,10 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		BaseUrl:           baseUrl,
 		ClientId:          cfg.Okta.IDX.ClientID,
 		Issuer:            cfg.Okta.IDX.Issuer,
-		State:             state,
+		State:             signedState,
 		Nonce:             nonce,
 		Pkce:              pkce,
-		InteractionHandle: interactionHandle,
+		InteractionHandle: authReq.InteractionHandle,
 	}
 	err = tpl.ExecuteTemplate(w, "login.gohtml", data)
 	if err != nil {
@@ -258,20 +301,30 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func LoginCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	// Check the state that was returned in the query string is the same as the above state
-	if r.URL.Query().Get("state") != state {
-		fmt.Fprintln(w, "The state was not as expected")
-		return
+	session, err := sessionStore.Get(r, sessionStoreName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
-	// Make sure the interaction_code was provided
-	if r.URL.Query().Get("interaction_code") == "" {
-		fmt.Fprintln(w, "The interaction_code was not returned or is not accessible")
+
+	// Check that the state that came back is the one we signed for this
+	// session's in-flight login attempt, not a forged, replayed, or
+	// cross-session value.
+	if !verifyLoginState(session, secrets.StateKey, r.URL.Query().Get("state")) {
+		fmt.Fprintln(w, "The state was not as expected")
 		return
 	}
+	nonce, _ := session.Values["nonce"].(string)
+	clearLoginState(session)
 
-	session, err := sessionStore.Get(r, sessionStoreName)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Okta IDX calls this an interaction_code; a standard OIDC redirect
+	// flow calls it a code. Either way it's the grant we exchange.
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		code = r.URL.Query().Get("interaction_code")
+	}
+	if code == "" {
+		fmt.Fprintln(w, "The authorization code was not returned or is not accessible")
+		return
 	}
 
 	if session.Values["pkce_code_verifier"] == nil ||
@@ -283,41 +336,14 @@ func LoginCallbackHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "Could not get PKCE Data from session")
 		return
 	}
-	q := r.URL.Query()
-	q.Del("state")
-
-	q.Add("grant_type", "interaction_code")
-	q.Set("interaction_code", r.URL.Query().Get("interaction_code"))
-	q.Add("client_id", cfg.Okta.IDX.ClientID)
-	q.Add("client_secret", cfg.Okta.IDX.ClientSecret)
-	q.Add("code_verifier", session.Values["pkce_code_verifier"].(string))
-
-	url := cfg.Okta.IDX.Issuer + "/oauth2/v1/token?" + q.Encode()
-
-	req, _ := http.NewRequest("POST", url, bytes.NewReader([]byte("")))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatalf("RESP ERROR: %+v\n", err.Error())
-	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("READ ERROR: %+v\n", err.Error())
-	}
-	defer resp.Body.Close()
 
-	var exchange Exchange
-	err = json.Unmarshal(body, &exchange)
+	exchange, err := idp.Exchange(code, session.Values["pkce_code_verifier"].(string))
 	if err != nil {
-		log.Fatalf("UNMARSHAL ERROR: %+v\n", err.Error())
+		log.Fatalf("EXCHANGE ERROR: %+v\n", err.Error())
 	}
 
-	_, verificationError := verifyToken(exchange.IdToken)
-
-	if verificationError != nil {
-		log.Fatalf("Verification Error: %+v\n", verificationError)
+	if _, err := idp.VerifyIDToken(exchange.IdToken, nonce); err != nil {
+		log.Fatalf("Verification Error: %+v\n", err)
 	}
 
 	session.Values["id_token"] = exchange.IdToken
@@ -328,24 +354,108 @@ func LoginCallbackHandler(w http.ResponseWriter, r *http.Request) {
 		log.Fatalf("SESSION SAVE ERROR: %+v\n", err.Error())
 	}
 
+	if err := cacheTokens(exchange); err != nil {
+		fmt.Printf("could not cache tokens: %s\n", err.Error())
+	}
+
 	http.Redirect(w, r, "/", http.StatusFound)
 
 }
 
+// cacheTokens persists a successful token exchange to the on-disk
+// tokencache so a later process/run can refresh instead of forcing the
+// user through another interactive login.
+func cacheTokens(exchange provider.Tokens) error {
+	scopes := scopesWithOfflineAccess(cfg.Okta.IDX.Scopes)
+	entry := tokencache.Entry{
+		Issuer:       cfg.Okta.IDX.Issuer,
+		ClientID:     cfg.Okta.IDX.ClientID,
+		Scopes:       scopes,
+		TokenType:    exchange.TokenType,
+		AccessToken:  exchange.AccessToken,
+		RefreshToken: exchange.RefreshToken,
+		IdToken:      exchange.IdToken,
+		Expiry:       time.Now().Add(time.Duration(exchange.ExpiresIn) * time.Second),
+	}
+	return tokenCache.Put(entry)
+}
+
+// scopesWithOfflineAccess returns scopes with "offline_access" appended
+// if it isn't already requested, so the token endpoint issues a
+// refresh_token alongside the access/id tokens.
+func scopesWithOfflineAccess(scopes []string) []string {
+	for _, s := range scopes {
+		if s == "offline_access" {
+			return scopes
+		}
+	}
+	return append(append([]string{}, scopes...), "offline_access")
+}
+
+// LogoutHandler begins RP-Initiated Logout: it stashes a fresh state in
+// the session and sends the browser to the IdP's end_session_endpoint
+// with the current id_token as id_token_hint, so the IdP's own session
+// is ended too, not just this app's. If the provider has no
+// end_session_endpoint to send the browser to, it falls back to just
+// clearing the local session.
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	session, err := sessionStore.Get(r, sessionStoreName)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 
-	delete(session.Values, "id_token")
-	delete(session.Values, "access_token")
+	idToken, _ := session.Values["id_token"].(string)
 
+	if idToken != "" {
+		logoutState, err := generateNonce()
+		if err != nil {
+			fmt.Printf("could not create logout state: %s\n", err.Error())
+		} else if logoutURL := idp.LogoutURL(idToken, cfg.Okta.IDX.PostLogoutRedirectURI, logoutState); logoutURL != "" {
+			session.Values["logout_state"] = logoutState
+			if err := session.Save(r, w); err != nil {
+				fmt.Printf("could not save logout state: %s\n", err.Error())
+			}
+			http.Redirect(w, r, logoutURL, http.StatusFound)
+			return
+		}
+	}
+
+	clearSession(session)
 	session.Save(r, w)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// LogoutCallbackHandler is where post_logout_redirect_uri points. It
+// validates the state RP-Initiated Logout was started with, then clears
+// the local session the same way LogoutHandler's fallback does.
+func LogoutCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := sessionStore.Get(r, sessionStoreName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+
+	wantState, _ := session.Values["logout_state"].(string)
+	if wantState == "" || r.URL.Query().Get("state") != wantState {
+		fmt.Fprintln(w, "The state was not as expected")
+		return
+	}
+
+	clearSession(session)
+	if err := session.Save(r, w); err != nil {
+		fmt.Printf("could not save session: %s\n", err.Error())
+	}
 
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// clearSession removes everything LoginCallbackHandler and LogoutHandler
+// put into the session.
+func clearSession(session *sessions.Session) {
+	delete(session.Values, "id_token")
+	delete(session.Values, "access_token")
+	delete(session.Values, "logout_state")
+}
+
 func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	type customData struct {
 		Profile         map[string]string
@@ -360,71 +470,54 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getProfileData(r *http.Request) map[string]string {
-	m := make(map[string]string)
-
 	session, err := sessionStore.Get(r, sessionStoreName)
-
 	if err != nil || session.Values["access_token"] == nil || session.Values["access_token"] == "" {
-		return m
-	}
-
-	reqUrl := cfg.Okta.IDX.Issuer + "/oauth2/v1/userinfo"
-
-	req, _ := http.NewRequest("GET", reqUrl, bytes.NewReader([]byte("")))
-	h := req.Header
-	h.Add("Authorization", "Bearer "+session.Values["access_token"].(string))
-	h.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, _ := client.Do(req)
-	body, _ := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
-	json.Unmarshal(body, &m)
-
-	return m
-}
-
-func verifyToken(t string) (*verifier.Jwt, error) {
-	tv := map[string]string{}
-	tv["aud"] = cfg.Okta.IDX.ClientID
-	jv := verifier.JwtVerifier{
-		Issuer:           cfg.Okta.IDX.Issuer,
-		ClaimsToValidate: tv,
+		return map[string]string{}
 	}
 
-	result, err := jv.New().VerifyIdToken(t)
-
+	profile, err := idp.Userinfo(session.Values["access_token"].(string))
 	if err != nil {
-		return nil, fmt.Errorf("%s", err)
-	}
-
-	if result != nil {
-		return result, nil
+		fmt.Printf("could not fetch userinfo: %s\n", err.Error())
+		return map[string]string{}
 	}
-
-	return nil, fmt.Errorf("token could not be verified: %s", "")
-}
-
-type Exchange struct {
-	Error            string `json:"error,omitempty"`
-	ErrorDescription string `json:"error_description,omitempty"`
-	AccessToken      string `json:"access_token,omitempty"`
-	TokenType        string `json:"token_type,omitempty"`
-	ExpiresIn        int    `json:"expires_in,omitempty"`
-	Scope            string `json:"scope,omitempty"`
-	IdToken          string `json:"id_token,omitempty"`
+	return profile
 }
 
 type config struct {
 	Okta struct {
 		IDX struct {
-			ClientID     string   `mapstructure:"clientId" schema:"client_id"`
-			ClientSecret string   `mapstructure:"clientSecret" schema:"client_secret"`
-			Issuer       string   `mapstructure:"issuer" schema:"-"`
-			Scopes       []string `mapstructure:"scopes" schema:"scope"`
-			RedirectURI  string   `mapstructure:"redirectUri" schema:"redirect_uri"`
+			// Provider selects which provider.Provider implementation
+			// drives the login: "okta_idx" (default, the embedded
+			// sign-in widget), "oidc" (standard Authorization Code +
+			// PKCE against statically configured endpoints, e.g.
+			// Login.gov or a Dex connector), or "discovery" (the same
+			// flow as oidc, but with endpoints read from Issuer's
+			// `.well-known/openid-configuration`).
+			Provider              string   `mapstructure:"provider" schema:"-"`
+			ClientID              string   `mapstructure:"clientId" schema:"client_id"`
+			ClientSecret          string   `mapstructure:"clientSecret" schema:"client_secret"`
+			Issuer                string   `mapstructure:"issuer" schema:"-"`
+			Scopes                []string `mapstructure:"scopes" schema:"scope"`
+			RedirectURI           string   `mapstructure:"redirectUri" schema:"redirect_uri"`
+			AuthorizationEndpoint string   `mapstructure:"authorizationEndpoint" schema:"-"`
+			TokenEndpoint         string   `mapstructure:"tokenEndpoint" schema:"-"`
+			UserinfoEndpoint      string   `mapstructure:"userinfoEndpoint" schema:"-"`
+			// PostLogoutRedirectURI is where the IdP sends the browser
+			// back to after RP-Initiated Logout. It must be registered
+			// with the IdP the same way RedirectURI is.
+			PostLogoutRedirectURI string `mapstructure:"postLogoutRedirectUri" schema:"-"`
 		} `mapstructure:"idx"`
 	} `mapstructure:"okta"`
+	Session struct {
+		// HashKey and BlockKey are base64-encoded gorilla/securecookie
+		// keys used to sign and encrypt the session cookie. Key is a
+		// base64-encoded secret used to HMAC-bind login state to the
+		// session that issued it, see newLoginState. All three fall
+		// back to generated, persisted values when left unset.
+		HashKey  string `mapstructure:"hashKey" schema:"-"`
+		BlockKey string `mapstructure:"blockKey" schema:"-"`
+		Key      string `mapstructure:"key" schema:"-"`
+	} `mapstructure:"session"`
 }
 
 func (c config) Validate() error {
@@ -473,6 +566,12 @@ func ReadConfig(c *config, opts ...viper.DecoderConfigOption) error {
 	if c.Okta.IDX.RedirectURI == "" {
 		c.Okta.IDX.RedirectURI = fmt.Sprintf("%v", v.Get("REDIRECTURI"))
 	}
+	if c.Okta.IDX.Provider == "" {
+		c.Okta.IDX.Provider = "okta_idx"
+	}
+	if c.Okta.IDX.PostLogoutRedirectURI == "" {
+		c.Okta.IDX.PostLogoutRedirectURI = "http://localhost:8080/logout/callback"
+	}
 	return nil
 }
 
@@ -497,42 +596,3 @@ func isAuthenticated(r *http.Request) bool {
 
 	return true
 }
-
-// Get the interaction handle to begin the flow. Use this
-// value when initializing the Okta sign in widget.
-func getInteractionHandle(codeChallenge string) (string, error) {
-	data := url.Values{}
-	data.Set("client_id", cfg.Okta.IDX.ClientID)
-	data.Set("scope", strings.Join(cfg.Okta.IDX.Scopes, " "))
-	data.Set("code_challenge", codeChallenge)
-	data.Set("code_challenge_method", "S256")
-	data.Set("redirect_uri", cfg.Okta.IDX.RedirectURI)
-	data.Set("state", state)
-
-	endpoint := cfg.Okta.IDX.Issuer + "/oauth2/v1/interact"
-	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", fmt.Errorf("failed to create interact http request: %w", err)
-	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("http call has failed: %w", err)
-	}
-	type interactionHandleResponse struct {
-		InteractionHandle string `json:"interaction_handle"`
-	}
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("READ ERROR: %+v\n", err.Error())
-	}
-	defer resp.Body.Close()
-	var interactionHandle interactionHandleResponse
-	err = json.Unmarshal(body, &interactionHandle)
-	if err != nil {
-		return "", err
-	}
-
-	return interactionHandle.InteractionHandle, nil
-}
@@ -0,0 +1,119 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// metadata is the subset of `.well-known/openid-configuration` the
+// discovery provider depends on.
+type metadata struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// NewDiscovery returns a Provider that drives the standard Authorization
+// Code + PKCE flow, the same as OIDC, but learns its endpoints from
+// issuer's `.well-known/openid-configuration` document instead of
+// requiring them to be configured by hand. This is the right default for
+// any spec-compliant IdP, Dex included, that publishes discovery.
+func NewDiscovery(issuer, clientID, clientSecret, redirectURI string, scopes []string) (*OIDC, error) {
+	md, err := discover(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover issuer metadata: %w", err)
+	}
+	o, err := NewOIDC(issuer, clientID, clientSecret, redirectURI, scopes, md.AuthorizationEndpoint, md.TokenEndpoint, md.UserinfoEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	// The discovery document we just fetched already told us the
+	// end_session_endpoint, if any, so prime the cache instead of
+	// re-fetching it the first time LogoutURL is called.
+	o.endSession = newEndSessionCache(issuer, md.EndSessionEndpoint)
+	return o, nil
+}
+
+// discover fetches and parses issuer's OpenID Connect discovery document.
+func discover(issuer string) (*metadata, error) {
+	resp, err := http.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var md metadata
+	if err := json.Unmarshal(body, &md); err != nil {
+		return nil, err
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" {
+		return nil, fmt.Errorf("discovery document is missing authorization_endpoint or token_endpoint")
+	}
+	return &md, nil
+}
+
+// endSessionCache resolves and caches an issuer's end_session_endpoint,
+// so logging out repeatedly doesn't mean re-fetching discovery every
+// time. It's safe for concurrent use.
+type endSessionCache struct {
+	issuer string
+
+	once     sync.Once
+	endpoint string
+	err      error
+}
+
+// newEndSessionCache returns a cache for issuer. If the endpoint is
+// already known (e.g. from a discovery document fetched for another
+// reason), pass it as known to avoid a redundant fetch.
+//
+// It returns a pointer, not a value, because endSessionCache embeds a
+// sync.Once: copying one around after use would copy its lock.
+func newEndSessionCache(issuer, known string) *endSessionCache {
+	c := &endSessionCache{issuer: issuer}
+	if known != "" {
+		c.endpoint = known
+		c.once.Do(func() {})
+	}
+	return c
+}
+
+// get returns the issuer's end_session_endpoint, discovering it on the
+// first call.
+func (c *endSessionCache) get() (string, error) {
+	c.once.Do(func() {
+		md, err := discover(c.issuer)
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.endpoint = md.EndSessionEndpoint
+	})
+	return c.endpoint, c.err
+}
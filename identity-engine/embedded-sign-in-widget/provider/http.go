@@ -0,0 +1,125 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	verifier "github.com/okta/okta-jwt-verifier-golang"
+)
+
+// postForm issues a POST with an already url.Values-encoded body and
+// decodes the JSON response into out.
+func postForm(endpoint string, body []byte, out interface{}) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request to %s: %w", endpoint, err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response from %s: %w", endpoint, err)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response from %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+// fetchUserinfo gets claims for accessToken from a standard OIDC
+// userinfo endpoint.
+func fetchUserinfo(endpoint, accessToken string) (map[string]string, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build userinfo request: %w", err)
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Accept", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("userinfo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read userinfo response: %w", err)
+	}
+
+	claims := map[string]string{}
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal userinfo response: %w", err)
+	}
+	return claims, nil
+}
+
+// buildLogoutURL appends the standard RP-Initiated Logout parameters
+// (id_token_hint, post_logout_redirect_uri, state) to an
+// end_session_endpoint.
+func buildLogoutURL(endpoint, idTokenHint, postLogoutRedirectURI, state string) string {
+	q := url.Values{}
+	if idTokenHint != "" {
+		q.Set("id_token_hint", idTokenHint)
+	}
+	if postLogoutRedirectURI != "" {
+		q.Set("post_logout_redirect_uri", postLogoutRedirectURI)
+	}
+	if state != "" {
+		q.Set("state", state)
+	}
+	return endpoint + "?" + q.Encode()
+}
+
+// verifyIDToken validates idToken was issued by issuer for clientID. If
+// nonce is non-empty, it's also checked against the token's nonce claim,
+// binding the token to the specific login attempt that requested it.
+func verifyIDToken(issuer, clientID, idToken, nonce string) (*verifier.Jwt, error) {
+	if idToken == "" {
+		return nil, fmt.Errorf("token response did not include an id_token")
+	}
+	claims := map[string]string{"aud": clientID}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	jv := verifier.JwtVerifier{
+		Issuer:           issuer,
+		ClaimsToValidate: claims,
+	}
+	result, err := jv.New().VerifyIdToken(idToken)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("token could not be verified")
+	}
+	return result, nil
+}
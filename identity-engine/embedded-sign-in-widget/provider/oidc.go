@@ -0,0 +1,144 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	verifier "github.com/okta/okta-jwt-verifier-golang"
+)
+
+// OIDC drives a standard redirect-based Authorization Code + PKCE flow
+// against any spec-compliant OIDC IdP whose endpoints are known up
+// front, e.g. Login.gov or a statically configured Dex connector.
+type OIDC struct {
+	Issuer                string
+	ClientID              string
+	ClientSecret          string
+	RedirectURI           string
+	Scopes                []string
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	UserinfoEndpoint      string
+
+	endSession *endSessionCache
+}
+
+// NewOIDC returns a Provider that drives the standard Authorization Code
+// + PKCE flow against the given, statically configured endpoints.
+func NewOIDC(issuer, clientID, clientSecret, redirectURI string, scopes []string, authorizationEndpoint, tokenEndpoint, userinfoEndpoint string) (*OIDC, error) {
+	if authorizationEndpoint == "" || tokenEndpoint == "" {
+		return nil, fmt.Errorf("oidc provider requires authorizationEndpoint and tokenEndpoint to be configured")
+	}
+	return &OIDC{
+		Issuer:                issuer,
+		ClientID:              clientID,
+		ClientSecret:          clientSecret,
+		RedirectURI:           redirectURI,
+		Scopes:                scopes,
+		AuthorizationEndpoint: authorizationEndpoint,
+		TokenEndpoint:         tokenEndpoint,
+		UserinfoEndpoint:      userinfoEndpoint,
+		endSession:            newEndSessionCache(issuer, ""),
+	}, nil
+}
+
+// AuthCodeURL builds the standard authorization request redirect.
+func (p *OIDC) AuthCodeURL(state, nonce, codeChallenge, codeChallengeMethod string) (AuthRequest, error) {
+	q := url.Values{}
+	q.Set("client_id", p.ClientID)
+	q.Set("response_type", "code")
+	q.Set("response_mode", "query")
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("redirect_uri", p.RedirectURI)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", codeChallengeMethod)
+
+	return AuthRequest{RedirectURL: p.AuthorizationEndpoint + "?" + q.Encode()}, nil
+}
+
+// Exchange trades an authorization_code for tokens.
+func (p *OIDC) Exchange(code, codeVerifier string) (Tokens, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("client_id", p.ClientID)
+	data.Set("client_secret", p.ClientSecret)
+	data.Set("redirect_uri", p.RedirectURI)
+	data.Set("code", code)
+	data.Set("code_verifier", codeVerifier)
+
+	var tokens Tokens
+	if err := postForm(p.TokenEndpoint, []byte(data.Encode()), &tokens); err != nil {
+		return Tokens{}, err
+	}
+	if tokens.Error != "" {
+		return Tokens{}, fmt.Errorf("token endpoint returned error: %s: %s", tokens.Error, tokens.ErrorDescription)
+	}
+	return tokens, nil
+}
+
+// Refresh trades refreshToken for a new token set against this
+// provider's token endpoint.
+func (p *OIDC) Refresh(refreshToken string, scopes []string) (Tokens, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	data.Set("client_id", p.ClientID)
+	data.Set("client_secret", p.ClientSecret)
+	data.Set("scope", strings.Join(scopes, " "))
+
+	var tokens Tokens
+	if err := postForm(p.TokenEndpoint, []byte(data.Encode()), &tokens); err != nil {
+		return Tokens{}, err
+	}
+	if tokens.Error != "" {
+		return Tokens{}, fmt.Errorf("token endpoint returned error: %s: %s", tokens.Error, tokens.ErrorDescription)
+	}
+	return tokens, nil
+}
+
+// Userinfo fetches claims for accessToken, if a userinfo endpoint was
+// configured.
+func (p *OIDC) Userinfo(accessToken string) (map[string]string, error) {
+	if p.UserinfoEndpoint == "" {
+		return map[string]string{}, nil
+	}
+	return fetchUserinfo(p.UserinfoEndpoint, accessToken)
+}
+
+// LogoutURL returns the RP-Initiated Logout URL for this issuer's
+// end_session_endpoint, discovered from `.well-known/openid-configuration`
+// and cached, or "" if the issuer doesn't advertise one - callers should
+// fall back to clearing the local session only in that case.
+func (p *OIDC) LogoutURL(idTokenHint, postLogoutRedirectURI, state string) string {
+	endpoint, err := p.endSession.get()
+	if err != nil || endpoint == "" {
+		return ""
+	}
+	return buildLogoutURL(endpoint, idTokenHint, postLogoutRedirectURI, state)
+}
+
+// VerifyIDToken validates idToken was issued by this provider's issuer
+// for its client ID, and, if nonce is non-empty, that it matches the
+// token's nonce claim.
+func (p *OIDC) VerifyIDToken(idToken, nonce string) (*verifier.Jwt, error) {
+	return verifyIDToken(p.Issuer, p.ClientID, idToken, nonce)
+}
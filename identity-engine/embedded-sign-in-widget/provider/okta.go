@@ -0,0 +1,160 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	verifier "github.com/okta/okta-jwt-verifier-golang"
+)
+
+// OktaIDX drives Okta's Identity Engine interaction-code flow: the login
+// page calls /oauth2/v1/interact to get an interaction_handle, hands that
+// to the embedded sign-in widget, and the widget's own calls to the IDX
+// API eventually redirect back with an interaction_code to exchange.
+type OktaIDX struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	Scopes       []string
+
+	endSession *endSessionCache
+}
+
+// NewOktaIDX returns a Provider that drives Okta's IDX interaction-code
+// flow against issuer.
+func NewOktaIDX(issuer, clientID, clientSecret, redirectURI string, scopes []string) *OktaIDX {
+	return &OktaIDX{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURI:  redirectURI,
+		Scopes:       scopes,
+		endSession:   newEndSessionCache(issuer, ""),
+	}
+}
+
+// AuthCodeURL gets an interaction_handle for codeChallenge from
+// /oauth2/v1/interact. The embedded widget uses it to initialize itself,
+// so there's no URL to redirect the browser to.
+func (p *OktaIDX) AuthCodeURL(state, nonce, codeChallenge, codeChallengeMethod string) (AuthRequest, error) {
+	data := url.Values{}
+	data.Set("client_id", p.ClientID)
+	data.Set("scope", strings.Join(p.Scopes, " "))
+	data.Set("code_challenge", codeChallenge)
+	data.Set("code_challenge_method", codeChallengeMethod)
+	data.Set("redirect_uri", p.RedirectURI)
+	data.Set("state", state)
+
+	req, err := http.NewRequest(http.MethodPost, p.Issuer+"/oauth2/v1/interact", strings.NewReader(data.Encode()))
+	if err != nil {
+		return AuthRequest{}, fmt.Errorf("failed to create interact http request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return AuthRequest{}, fmt.Errorf("http call has failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return AuthRequest{}, fmt.Errorf("failed to read interact response: %w", err)
+	}
+
+	var interactionResponse struct {
+		InteractionHandle string `json:"interaction_handle"`
+	}
+	if err := json.Unmarshal(body, &interactionResponse); err != nil {
+		return AuthRequest{}, err
+	}
+
+	return AuthRequest{InteractionHandle: interactionResponse.InteractionHandle}, nil
+}
+
+// Exchange trades the interaction_code the widget redirected back with
+// for tokens.
+func (p *OktaIDX) Exchange(code, codeVerifier string) (Tokens, error) {
+	data := url.Values{}
+	data.Set("grant_type", "interaction_code")
+	data.Set("interaction_code", code)
+	data.Set("client_id", p.ClientID)
+	data.Set("client_secret", p.ClientSecret)
+	data.Set("code_verifier", codeVerifier)
+
+	var tokens Tokens
+	if err := postForm(p.Issuer+"/oauth2/v1/token?"+data.Encode(), nil, &tokens); err != nil {
+		return Tokens{}, err
+	}
+	if tokens.Error != "" {
+		return Tokens{}, fmt.Errorf("token endpoint returned error: %s: %s", tokens.Error, tokens.ErrorDescription)
+	}
+	return tokens, nil
+}
+
+// Refresh trades refreshToken for a new token set against Okta's token
+// endpoint.
+func (p *OktaIDX) Refresh(refreshToken string, scopes []string) (Tokens, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	data.Set("client_id", p.ClientID)
+	data.Set("client_secret", p.ClientSecret)
+	data.Set("scope", strings.Join(scopes, " "))
+
+	var tokens Tokens
+	if err := postForm(p.Issuer+"/oauth2/v1/token", []byte(data.Encode()), &tokens); err != nil {
+		return Tokens{}, err
+	}
+	if tokens.Error != "" {
+		return Tokens{}, fmt.Errorf("token endpoint returned error: %s: %s", tokens.Error, tokens.ErrorDescription)
+	}
+	return tokens, nil
+}
+
+// Userinfo fetches claims for accessToken from Okta's userinfo endpoint.
+func (p *OktaIDX) Userinfo(accessToken string) (map[string]string, error) {
+	return fetchUserinfo(p.Issuer+"/oauth2/v1/userinfo", accessToken)
+}
+
+// LogoutURL returns the RP-Initiated Logout URL for this issuer's
+// end_session_endpoint, discovered from `.well-known/openid-configuration`
+// and cached. If discovery doesn't advertise one, it falls back to
+// Okta's classic /oauth2/v1/logout endpoint, which accepts the same
+// parameters.
+func (p *OktaIDX) LogoutURL(idTokenHint, postLogoutRedirectURI, state string) string {
+	endpoint, err := p.endSession.get()
+	if err != nil || endpoint == "" {
+		endpoint = p.Issuer + "/oauth2/v1/logout"
+	}
+	return buildLogoutURL(endpoint, idTokenHint, postLogoutRedirectURI, state)
+}
+
+// VerifyIDToken validates idToken was issued by this provider's issuer
+// for its client ID, and, if nonce is non-empty, that it matches the
+// token's nonce claim.
+func (p *OktaIDX) VerifyIDToken(idToken, nonce string) (*verifier.Jwt, error) {
+	return verifyIDToken(p.Issuer, p.ClientID, idToken, nonce)
+}
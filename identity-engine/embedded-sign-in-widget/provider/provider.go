@@ -0,0 +1,85 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package provider abstracts the OAuth 2.0 / OIDC interactions the sample
+// needs behind a single Provider interface, so the rest of the app can
+// drive either Okta's IDX `/interact` flow or a standard redirect-based
+// Authorization Code + PKCE flow against another IdP without caring which
+// one it's talking to.
+package provider
+
+import (
+	verifier "github.com/okta/okta-jwt-verifier-golang"
+)
+
+// AuthRequest is what a Provider needs the login page to do to begin the
+// authorization flow.
+type AuthRequest struct {
+	// RedirectURL is where the browser should be sent to continue the
+	// flow. It's empty for providers, like Okta IDX, that render an
+	// embedded widget in place rather than redirecting away.
+	RedirectURL string
+	// InteractionHandle is populated by the Okta IDX provider from
+	// /oauth2/v1/interact so the embedded sign-in widget can pick up
+	// where it left off.
+	InteractionHandle string
+}
+
+// Tokens is the body returned by a token endpoint, whether from an
+// interaction_code or an authorization_code grant.
+type Tokens struct {
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	AccessToken      string `json:"access_token,omitempty"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	TokenType        string `json:"token_type,omitempty"`
+	ExpiresIn        int    `json:"expires_in,omitempty"`
+	Scope            string `json:"scope,omitempty"`
+	IdToken          string `json:"id_token,omitempty"`
+}
+
+// Provider is the set of OAuth 2.0 / OIDC operations the sample's
+// handlers need. Implementations exist for Okta's IDX flow, a generic
+// OIDC Authorization Code + PKCE flow with statically configured
+// endpoints (e.g. Login.gov, Dex), and a discovery-based variant of the
+// latter that reads the endpoints from `.well-known/openid-configuration`.
+type Provider interface {
+	// AuthCodeURL begins the authorization flow for the given state,
+	// nonce, and PKCE code challenge.
+	AuthCodeURL(state, nonce, codeChallenge, codeChallengeMethod string) (AuthRequest, error)
+
+	// Exchange trades an authorization grant - an authorization_code, or
+	// for Okta IDX an interaction_code - for tokens.
+	Exchange(code, codeVerifier string) (Tokens, error)
+
+	// Refresh trades a refresh_token for a new token set, against this
+	// provider's own token endpoint, so callers don't need to know its
+	// URL shape.
+	Refresh(refreshToken string, scopes []string) (Tokens, error)
+
+	// Userinfo fetches claims for the user identified by accessToken.
+	Userinfo(accessToken string) (map[string]string, error)
+
+	// LogoutURL returns the URL the user's browser should be sent to in
+	// order to end their session at the IdP, or "" if the provider
+	// doesn't support RP-initiated logout.
+	LogoutURL(idTokenHint, postLogoutRedirectURI, state string) string
+
+	// VerifyIDToken validates idToken's signature and standard claims. If
+	// nonce is non-empty, it's also checked against the token's nonce
+	// claim, binding the token to the login attempt that requested it.
+	VerifyIDToken(idToken, nonce string) (*verifier.Jwt, error)
+}
@@ -0,0 +1,42 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/provider"
+)
+
+// newProvider instantiates the provider.Provider selected by
+// cfg.Okta.IDX.Provider.
+func newProvider(cfg *config) (provider.Provider, error) {
+	idx := cfg.Okta.IDX
+	scopes := scopesWithOfflineAccess(idx.Scopes)
+
+	switch idx.Provider {
+	case "", "okta_idx":
+		return provider.NewOktaIDX(idx.Issuer, idx.ClientID, idx.ClientSecret, idx.RedirectURI, scopes), nil
+	case "oidc":
+		return provider.NewOIDC(idx.Issuer, idx.ClientID, idx.ClientSecret, idx.RedirectURI, scopes,
+			idx.AuthorizationEndpoint, idx.TokenEndpoint, idx.UserinfoEndpoint)
+	case "discovery":
+		return provider.NewDiscovery(idx.Issuer, idx.ClientID, idx.ClientSecret, idx.RedirectURI, scopes)
+	default:
+		return nil, fmt.Errorf("unknown provider %q (want okta_idx, oidc, or discovery)", idx.Provider)
+	}
+}
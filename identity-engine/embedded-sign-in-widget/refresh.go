@@ -0,0 +1,98 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/provider"
+	"github.com/okta/samples-golang/identity-engine/embedded-sign-in-widget/tokencache"
+)
+
+// refreshSkew is how far ahead of the cached expiry we proactively
+// refresh, so a request doesn't race a token that's valid when checked
+// but expired by the time it reaches the authorization server.
+const refreshSkew = 60 * time.Second
+
+// refreshMiddleware transparently renews the session's access/id tokens
+// from the cached refresh_token when they're at or past refreshSkew from
+// expiring. It's a no-op for anonymous requests.
+func refreshMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := sessionStore.Get(r, sessionStoreName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if session.Values["id_token"] != nil && session.Values["id_token"] != "" {
+			entry, err := tokenCache.Get(cfg.Okta.IDX.Issuer, cfg.Okta.IDX.ClientID, scopesWithOfflineAccess(cfg.Okta.IDX.Scopes))
+			if err != nil {
+				fmt.Printf("could not read token cache: %s\n", err.Error())
+			} else if entry != nil && entry.RefreshToken != "" && time.Until(entry.Expiry) < refreshSkew {
+				refreshed, err := refreshTokens(*entry)
+				if err != nil {
+					fmt.Printf("could not refresh tokens: %s\n", err.Error())
+					if delErr := tokenCache.Delete(entry.Issuer, entry.ClientID, entry.Scopes); delErr != nil {
+						fmt.Printf("could not evict stale token cache entry: %s\n", delErr.Error())
+					}
+				} else {
+					session.Values["id_token"] = refreshed.IdToken
+					session.Values["access_token"] = refreshed.AccessToken
+					if err := session.Save(r, w); err != nil {
+						fmt.Printf("could not save refreshed session: %s\n", err.Error())
+					}
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// refreshTokens exchanges entry's refresh_token for a new token set,
+// re-verifies the new id_token the same way the login callback does,
+// and persists the result back into the tokencache.
+//
+// The refresh grant goes through idp, the same provider.Provider the
+// rest of the app uses, so this works against whichever token endpoint
+// the configured provider actually has - Okta, or an OIDC/discovery
+// provider with its own endpoint shape - rather than assuming Okta's.
+func refreshTokens(entry tokencache.Entry) (provider.Tokens, error) {
+	exchange, err := idp.Refresh(entry.RefreshToken, entry.Scopes)
+	if err != nil {
+		return provider.Tokens{}, fmt.Errorf("refresh request failed: %w", err)
+	}
+	if exchange.Error != "" {
+		return provider.Tokens{}, fmt.Errorf("refresh was rejected: %s: %s", exchange.Error, exchange.ErrorDescription)
+	}
+
+	if _, err := idp.VerifyIDToken(exchange.IdToken, ""); err != nil {
+		return provider.Tokens{}, fmt.Errorf("refreshed id_token failed verification: %w", err)
+	}
+
+	if exchange.RefreshToken == "" {
+		exchange.RefreshToken = entry.RefreshToken
+	}
+	if err := cacheTokens(exchange); err != nil {
+		fmt.Printf("could not cache refreshed tokens: %s\n", err.Error())
+	}
+
+	return exchange, nil
+}
@@ -0,0 +1,144 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sessionSecrets is the key material that secures the session cookie -
+// HashKey and BlockKey, handed to gorilla/securecookie - and binds login
+// state to the session that issued it (StateKey, see newLoginState).
+type sessionSecrets struct {
+	HashKey  []byte
+	BlockKey []byte
+	StateKey []byte
+}
+
+// loadSessionSecrets returns the session keys cfg configures, falling
+// back - one key at a time - to keys generated on first run and
+// persisted to $HOME/.okta/session.key, the same way tokencache persists
+// its encryption key, so cookies issued and logins started before a
+// restart are still valid afterward.
+func loadSessionSecrets(cfg *config) (*sessionSecrets, error) {
+	secrets, err := loadOrCreateSessionKeyFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Session.HashKey != "" {
+		if secrets.HashKey, err = base64.StdEncoding.DecodeString(cfg.Session.HashKey); err != nil {
+			return nil, fmt.Errorf("session.hashKey is not valid base64: %w", err)
+		}
+	}
+	if cfg.Session.BlockKey != "" {
+		if secrets.BlockKey, err = base64.StdEncoding.DecodeString(cfg.Session.BlockKey); err != nil {
+			return nil, fmt.Errorf("session.blockKey is not valid base64: %w", err)
+		}
+	}
+	if cfg.Session.Key != "" {
+		if secrets.StateKey, err = base64.StdEncoding.DecodeString(cfg.Session.Key); err != nil {
+			return nil, fmt.Errorf("session.key is not valid base64: %w", err)
+		}
+	}
+	return secrets, nil
+}
+
+// loadOrCreateSessionKeyFile reads the hash/block/state keys from
+// $HOME/.okta/session.key, generating and persisting a new set with 0600
+// permissions the first time it's needed.
+func loadOrCreateSessionKeyFile() (*sessionSecrets, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine home directory: %w", err)
+	}
+	dir := filepath.Join(home, ".okta")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, "session.key")
+
+	raw, err := ioutil.ReadFile(path)
+	if err == nil {
+		lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+		if len(lines) != 3 {
+			return nil, fmt.Errorf("%s does not contain a valid session key set", path)
+		}
+		secrets := &sessionSecrets{}
+		for i, encoded := range lines {
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("%s does not contain a valid session key set: %w", path, err)
+			}
+			switch i {
+			case 0:
+				secrets.HashKey = decoded
+			case 1:
+				secrets.BlockKey = decoded
+			case 2:
+				secrets.StateKey = decoded
+			}
+		}
+		return secrets, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	secrets := &sessionSecrets{}
+	if secrets.HashKey, err = randomBytes(32); err != nil {
+		return nil, err
+	}
+	if secrets.BlockKey, err = randomBytes(32); err != nil {
+		return nil, err
+	}
+	if secrets.StateKey, err = randomBytes(32); err != nil {
+		return nil, err
+	}
+
+	encoded := strings.Join([]string{
+		base64.StdEncoding.EncodeToString(secrets.HashKey),
+		base64.StdEncoding.EncodeToString(secrets.BlockKey),
+		base64.StdEncoding.EncodeToString(secrets.StateKey),
+	}, "\n")
+	if err := ioutil.WriteFile(path, []byte(encoded), 0600); err != nil {
+		return nil, fmt.Errorf("could not persist session keys to %s: %w", path, err)
+	}
+	return secrets, nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func randomString(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
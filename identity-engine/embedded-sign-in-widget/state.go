@@ -0,0 +1,103 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// stateTTL is how long a login attempt's state is valid for. A callback
+// arriving after this window is rejected as expired, the same as a
+// forged or replayed one.
+const stateTTL = 10 * time.Minute
+
+// newLoginState mints a random state and nonce for a new login attempt
+// and stores them - plus when they were issued and this session's ID -
+// in session. It returns the state in its HMAC-signed form, which is
+// the value that actually goes to the IdP as the OAuth `state`
+// parameter.
+//
+// Binding the value the browser carries to (raw state, issued_at,
+// session ID) with a server-only key means a callback can only be
+// satisfied by a request that round-tripped through this exact login
+// attempt: it can't be satisfied by replaying an old value, by a state
+// minted for a different session, or by guessing.
+func newLoginState(session *sessions.Session, stateKey []byte) (signedState, nonce string, err error) {
+	sid, _ := session.Values["sid"].(string)
+	if sid == "" {
+		if sid, err = randomString(32); err != nil {
+			return "", "", fmt.Errorf("failed to create session id: %w", err)
+		}
+		session.Values["sid"] = sid
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create state: %w", err)
+	}
+	nonce, err = generateNonce()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create nonce: %w", err)
+	}
+
+	issuedAt := time.Now().Unix()
+	session.Values["state"] = state
+	session.Values["state_issued_at"] = issuedAt
+	session.Values["nonce"] = nonce
+
+	return signState(stateKey, state, issuedAt, sid), nonce, nil
+}
+
+// verifyLoginState reports whether signedState is the value
+// newLoginState most recently issued for session, and that it arrived
+// within stateTTL. It does not consume the state; callers should clear
+// session's state values once they've finished with them so a valid
+// state can't be replayed.
+func verifyLoginState(session *sessions.Session, stateKey []byte, signedState string) bool {
+	sid, _ := session.Values["sid"].(string)
+	state, _ := session.Values["state"].(string)
+	issuedAt, _ := session.Values["state_issued_at"].(int64)
+	if sid == "" || state == "" || issuedAt == 0 {
+		return false
+	}
+	if time.Since(time.Unix(issuedAt, 0)) > stateTTL {
+		return false
+	}
+
+	want := signState(stateKey, state, issuedAt, sid)
+	return hmac.Equal([]byte(want), []byte(signedState))
+}
+
+// clearLoginState removes a consumed or abandoned login attempt's state
+// from the session, so it can't be replayed.
+func clearLoginState(session *sessions.Session) {
+	delete(session.Values, "state")
+	delete(session.Values, "state_issued_at")
+	delete(session.Values, "nonce")
+}
+
+func signState(stateKey []byte, state string, issuedAt int64, sid string) string {
+	mac := hmac.New(sha256.New, stateKey)
+	fmt.Fprintf(mac, "%s|%d|%s", state, issuedAt, sid)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,124 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func newTestSession() *sessions.Session {
+	store := sessions.NewCookieStore([]byte("test-hash-key-0123456789abcdef"))
+	return sessions.NewSession(store, sessionStoreName)
+}
+
+func mustStateKey() []byte {
+	key, err := randomBytes(32)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func TestVerifyLoginStateAccepts(t *testing.T) {
+	stateKey := mustStateKey()
+	session := newTestSession()
+
+	signedState, _, err := newLoginState(session, stateKey)
+	if err != nil {
+		t.Fatalf("newLoginState returned error: %s", err)
+	}
+
+	if !verifyLoginState(session, stateKey, signedState) {
+		t.Fatal("verifyLoginState rejected the state it just issued")
+	}
+}
+
+func TestVerifyLoginStateRejectsReplay(t *testing.T) {
+	stateKey := mustStateKey()
+	session := newTestSession()
+
+	signedState, _, err := newLoginState(session, stateKey)
+	if err != nil {
+		t.Fatalf("newLoginState returned error: %s", err)
+	}
+	if !verifyLoginState(session, stateKey, signedState) {
+		t.Fatal("verifyLoginState rejected a fresh state")
+	}
+
+	// The callback handler clears the state once it's been used; a
+	// second callback with the same value must not be accepted.
+	clearLoginState(session)
+	if verifyLoginState(session, stateKey, signedState) {
+		t.Fatal("verifyLoginState accepted a replayed state after it was cleared")
+	}
+}
+
+func TestVerifyLoginStateRejectsCrossSessionSubstitution(t *testing.T) {
+	stateKey := mustStateKey()
+
+	sessionA := newTestSession()
+	signedStateA, _, err := newLoginState(sessionA, stateKey)
+	if err != nil {
+		t.Fatalf("newLoginState returned error: %s", err)
+	}
+
+	sessionB := newTestSession()
+	if _, _, err := newLoginState(sessionB, stateKey); err != nil {
+		t.Fatalf("newLoginState returned error: %s", err)
+	}
+
+	// sessionA's signed state must not validate against sessionB, even
+	// though sessionB has a login attempt in flight of its own.
+	if verifyLoginState(sessionB, stateKey, signedStateA) {
+		t.Fatal("verifyLoginState accepted a state signed for a different session")
+	}
+}
+
+func TestVerifyLoginStateRejectsExpired(t *testing.T) {
+	stateKey := mustStateKey()
+	session := newTestSession()
+
+	if _, _, err := newLoginState(session, stateKey); err != nil {
+		t.Fatalf("newLoginState returned error: %s", err)
+	}
+
+	// Backdate the attempt and re-sign it for the backdated time, so the
+	// signature is valid and only the age of the state can reject it.
+	issuedAt := time.Now().Add(-stateTTL - time.Minute).Unix()
+	session.Values["state_issued_at"] = issuedAt
+	signedState := signState(stateKey, session.Values["state"].(string), issuedAt, session.Values["sid"].(string))
+
+	if verifyLoginState(session, stateKey, signedState) {
+		t.Fatal("verifyLoginState accepted a state issued outside stateTTL")
+	}
+}
+
+func TestVerifyLoginStateRejectsWrongKey(t *testing.T) {
+	session := newTestSession()
+
+	signedState, _, err := newLoginState(session, mustStateKey())
+	if err != nil {
+		t.Fatalf("newLoginState returned error: %s", err)
+	}
+
+	if verifyLoginState(session, mustStateKey(), signedState) {
+		t.Fatal("verifyLoginState accepted a state signed with a different key")
+	}
+}
@@ -0,0 +1,269 @@
+/**
+ * Copyright 2021 - Present Okta, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tokencache persists OAuth 2.0 / OIDC token responses to an
+// encrypted file under $HOME/.okta/tokens.json so that a sample doesn't
+// have to send a user back through an interactive login every time it
+// runs. Entries are keyed by (issuer, client ID, scopes), matching how a
+// single machine may hold tokens for more than one app or environment.
+package tokencache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// Entry is a single cached token response, plus enough context
+// (issuer/client/scopes) to know when it's still a valid match for a
+// login request, and an expiry so callers know when to refresh it.
+type Entry struct {
+	Issuer       string    `json:"issuer"`
+	ClientID     string    `json:"client_id"`
+	Scopes       []string  `json:"scopes"`
+	TokenType    string    `json:"token_type"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IdToken      string    `json:"id_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// key returns the string used to index the on-disk map. Scopes are
+// sorted so request order doesn't create spurious cache misses.
+func (e *Entry) key() string {
+	scopes := append([]string(nil), e.Scopes...)
+	sort.Strings(scopes)
+	return e.Issuer + "|" + e.ClientID + "|" + strings.Join(scopes, " ")
+}
+
+// Cache is a file-backed, encrypted, process-shared store of Entry
+// values. The zero value is not usable; construct one with New.
+type Cache struct {
+	path     string
+	lockPath string
+	key      [32]byte
+}
+
+// New returns a Cache backed by $HOME/.okta/tokens.json, creating the
+// directory and the encryption key used to protect it if they don't
+// already exist.
+func New() (*Cache, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine home directory: %w", err)
+	}
+	return NewAt(filepath.Join(home, ".okta"))
+}
+
+// NewAt returns a Cache rooted at dir, storing tokens.json and the
+// encryption key (cache.key) inside it, for callers that want a
+// directory other than $HOME/.okta.
+func NewAt(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create %s: %w", dir, err)
+	}
+
+	key, err := loadOrCreateKey(filepath.Join(dir, "cache.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, "tokens.json")
+	return &Cache{
+		path:     path,
+		lockPath: path + ".lock",
+		key:      key,
+	}, nil
+}
+
+// Get returns the cached entry for (issuer, clientID, scopes), or
+// (nil, nil) if there isn't one.
+func (c *Cache) Get(issuer, clientID string, scopes []string) (*Entry, error) {
+	var found *Entry
+	want := (&Entry{Issuer: issuer, ClientID: clientID, Scopes: scopes}).key()
+
+	err := c.withLock(func(entries map[string]Entry) (map[string]Entry, error) {
+		if e, ok := entries[want]; ok {
+			found = &e
+		}
+		return entries, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// Put writes e into the cache, replacing any existing entry for the same
+// (issuer, clientID, scopes).
+func (c *Cache) Put(e Entry) error {
+	return c.withLock(func(entries map[string]Entry) (map[string]Entry, error) {
+		entries[e.key()] = e
+		return entries, nil
+	})
+}
+
+// Delete evicts the entry for (issuer, clientID, scopes), e.g. after its
+// id_token fails re-verification on refresh.
+func (c *Cache) Delete(issuer, clientID string, scopes []string) error {
+	want := (&Entry{Issuer: issuer, ClientID: clientID, Scopes: scopes}).key()
+	return c.withLock(func(entries map[string]Entry) (map[string]Entry, error) {
+		delete(entries, want)
+		return entries, nil
+	})
+}
+
+// withLock takes an inter-process file lock on lockPath, loads and
+// decrypts the current entries, lets fn mutate them, and writes the
+// result back encrypted. This keeps concurrent processes sharing the
+// same cache from clobbering each other's writes.
+func (c *Cache) withLock(fn func(map[string]Entry) (map[string]Entry, error)) error {
+	fl := flock.New(c.lockPath)
+	if err := fl.Lock(); err != nil {
+		return fmt.Errorf("could not lock %s: %w", c.lockPath, err)
+	}
+	defer fl.Unlock()
+
+	entries, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	entries, err = fn(entries)
+	if err != nil {
+		return err
+	}
+
+	return c.save(entries)
+}
+
+func (c *Cache) load() (map[string]Entry, error) {
+	ciphertext, err := ioutil.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]Entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", c.path, err)
+	}
+	if len(ciphertext) == 0 {
+		return map[string]Entry{}, nil
+	}
+
+	plaintext, err := decrypt(c.key, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt %s: %w", c.path, err)
+	}
+
+	var entries map[string]Entry
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", c.path, err)
+	}
+	return entries, nil
+}
+
+func (c *Cache) save(entries map[string]Entry) error {
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := encrypt(c.key, plaintext)
+	if err != nil {
+		return fmt.Errorf("could not encrypt token cache: %w", err)
+	}
+
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, ciphertext, 0600); err != nil {
+		return fmt.Errorf("could not write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// loadOrCreateKey reads a 32 byte AES-256 key from path, generating and
+// persisting one with 0600 permissions the first time it's needed.
+func loadOrCreateKey(path string) ([32]byte, error) {
+	var key [32]byte
+
+	raw, err := ioutil.ReadFile(path)
+	if err == nil {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+		if err != nil || len(decoded) != len(key) {
+			return key, fmt.Errorf("%s does not contain a valid cache key", path)
+		}
+		copy(key[:], decoded)
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return key, fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	if _, err := rand.Read(key[:]); err != nil {
+		return key, fmt.Errorf("could not generate cache key: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(key[:])
+	if err := ioutil.WriteFile(path, []byte(encoded), 0600); err != nil {
+		return key, fmt.Errorf("could not persist cache key to %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func encrypt(key [32]byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key [32]byte, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, body := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	return gcm.Open(nil, nonce, body, nil)
+}